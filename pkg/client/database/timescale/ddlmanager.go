@@ -2,7 +2,13 @@ package timescale
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/cloudquery/cloudquery/pkg/client/history"
 	"github.com/cloudquery/cq-provider-sdk/provider/schema"
@@ -15,11 +21,41 @@ import (
 const (
 	listHyperTables = `SELECT hypertable_name FROM timescaledb_information.hypertables WHERE hypertable_schema=$1 ORDER BY 1`
 
-	setChunkTimeInterval = `SELECT * FROM set_chunk_time_interval($1, INTERVAL '%d hour');`
-	dataRetentionPolicy  = `SELECT history.update_retention($1, INTERVAL '%d day');`
+	setChunkTimeInterval = `SELECT * FROM set_chunk_time_interval('%[1]s', INTERVAL '%[2]d hour');`
+	// The timezone is always passed; history.update_retention hands it on to
+	// add_retention_policy whenever it is not UTC, where it affects how
+	// calendar-length intervals are resolved against local time.
+	dataRetentionPolicy = `SELECT history.update_retention('%[1]s', INTERVAL '%[2]s', '%[3]s');`
+
+	selectTimescaleDBVersion = `SELECT extversion FROM pg_extension WHERE extname = 'timescaledb'`
 
 	dropTableView   = `DROP VIEW IF EXISTS "%[1]s"`
 	createTableView = `CREATE VIEW "%[1]s" AS SELECT * FROM history."%[1]s" WHERE cq_fetch_date = find_latest('history', '%[1]s')`
+
+	dropContinuousAggregate   = `DROP MATERIALIZED VIEW IF EXISTS history."%[1]s" CASCADE;`
+	createContinuousAggregate = `
+		CREATE MATERIALIZED VIEW IF NOT EXISTS history."%[1]s"
+		WITH (timescaledb.continuous) AS
+		SELECT time_bucket('%[2]s', cq_fetch_date) AS bucket,
+		       count(*) AS cq_row_count
+		FROM history."%[3]s"
+		GROUP BY 1
+		WITH NO DATA;`
+	addContinuousAggregatePolicy = `
+		SELECT add_continuous_aggregate_policy('history.%[1]s',
+			start_offset => NULL,
+			end_offset => INTERVAL '%[2]s',
+			schedule_interval => INTERVAL '%[3]s',
+			if_not_exists => true);`
+
+	compressHyperTable = `ALTER TABLE %[1]s SET (timescaledb.compress, timescaledb.compress_segmentby='%[2]s', timescaledb.compress_orderby='%[3]s');`
+	compressionPolicy  = `SELECT history.update_compression('%[1]s', INTERVAL '%[2]s');`
+	// removeCompressionPolicy is used by Inverse when rolling back a migration
+	// that enabled compression for the first time: there is no prior
+	// compression state to restore, so the best available undo stops the
+	// policy job. Chunks the forward migration already compressed stay
+	// compressed -- TimescaleDB has no bulk decompress operation.
+	removeCompressionPolicy = `SELECT remove_compression_policy('%[1]s', if_exists => true);`
 )
 
 type DDLManager struct {
@@ -29,7 +65,12 @@ type DDLManager struct {
 	dialect schema.Dialect
 }
 
-func NewDDLManager(l hclog.Logger, pool *pgxpool.Pool, cfg *history.Config, dt schema.DialectType) (*DDLManager, error) {
+// minTimescaleDBVersionForCalendarRetention is the first TimescaleDB version
+// whose add_retention_policy accepts a timezone argument, which month/year
+// retention units and any non-UTC timezone rely on.
+const minTimescaleDBVersionForCalendarRetention = "2.8"
+
+func NewDDLManager(ctx context.Context, l hclog.Logger, pool *pgxpool.Pool, cfg *history.Config, dt schema.DialectType) (*DDLManager, error) {
 	if dt != schema.TSDB {
 		return nil, fmt.Errorf("history is only supported on timescaledb")
 	}
@@ -39,6 +80,16 @@ func NewDDLManager(l hclog.Logger, pool *pgxpool.Pool, cfg *history.Config, dt s
 		return nil, err
 	}
 
+	if cfg.Retention.RequiresTimescaleDB28() {
+		ok, version, err := timescaleDBVersionAtLeast(ctx, pool, minTimescaleDBVersionForCalendarRetention)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check timescaledb version for retention unit %q, timezone %q: %w", cfg.Retention.Unit, cfg.Retention.Timezone, err)
+		}
+		if !ok {
+			return nil, fmt.Errorf("retention unit %q with timezone %q requires timescaledb >= %s, found %s", cfg.Retention.Unit, cfg.Retention.Timezone, minTimescaleDBVersionForCalendarRetention, version)
+		}
+	}
+
 	return &DDLManager{
 		log:     l,
 		pool:    pool,
@@ -47,13 +98,57 @@ func NewDDLManager(l hclog.Logger, pool *pgxpool.Pool, cfg *history.Config, dt s
 	}, nil
 }
 
+// timescaleDBVersionAtLeast reports whether the installed timescaledb
+// extension is at least min (major.minor), along with the installed version
+// string.
+func timescaleDBVersionAtLeast(ctx context.Context, pool *pgxpool.Pool, min string) (bool, string, error) {
+	var version string
+	if err := pgxscan.Get(ctx, pool, &version, selectTimescaleDBVersion); err != nil {
+		return false, "", fmt.Errorf("failed to determine installed timescaledb version: %w", err)
+	}
+
+	vMajor, vMinor, err := majorMinor(version)
+	if err != nil {
+		return false, version, fmt.Errorf("failed to parse timescaledb version %q: %w", version, err)
+	}
+	mMajor, mMinor, err := majorMinor(min)
+	if err != nil {
+		return false, version, fmt.Errorf("failed to parse minimum version %q: %w", min, err)
+	}
+
+	if vMajor != mMajor {
+		return vMajor > mMajor, version, nil
+	}
+	return vMinor >= mMinor, version, nil
+}
+
+func majorMinor(version string) (int, int, error) {
+	parts := strings.SplitN(version, ".", 3)
+	if len(parts) < 2 {
+		return 0, 0, fmt.Errorf("expected a major.minor version, got %q", version)
+	}
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, err
+	}
+	minor, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, 0, err
+	}
+	return major, minor, nil
+}
+
 func (d *DDLManager) Close() {
 	if d.pool != nil {
 		d.pool.Close()
 	}
 }
 
-// SetupHistory is run after any migrations, finalizing history setup
+// SetupHistory is run after any migrations, finalizing history setup. For
+// each hypertable it finds the latest applied migration, plans the next step
+// in the chain, and applies it through the history.migrations ledger (see
+// migrations.go), so that what CloudQuery did to a database is always
+// recorded and can be rolled back with RollbackCompleted.
 func (d *DDLManager) SetupHistory(ctx context.Context) error {
 	var tables []string
 	if err := pgxscan.Select(ctx, d.pool, &tables, listHyperTables, history.SchemaName); err != nil {
@@ -61,29 +156,88 @@ func (d *DDLManager) SetupHistory(ctx context.Context) error {
 	}
 
 	for _, table := range tables {
-		if err := d.configureHyperTable(ctx, table); err != nil {
-			return fmt.Errorf("failed to configure hypertable for table: %s: %w", table, err)
+		prevSchema, err := d.latestResultingSchemaForTable(ctx, table)
+		if err != nil {
+			return err
+		}
+		migration := d.planHyperTableMigration(table, prevSchema)
+		if migration == nil {
+			// Desired schema already matches the last completed migration for
+			// this table -- nothing to do.
+			continue
+		}
+		if err := d.Apply(ctx, *migration); err != nil {
+			// Apply's NonTransactional phase (continuous aggregate DDL) can
+			// fail after its transactional phase already committed the
+			// migration row as the active (done=false) one. Roll that back
+			// now, otherwise the row would permanently violate
+			// migrations_one_active_idx on every future boot. If nothing was
+			// actually committed -- the transactional phase itself failed,
+			// so Postgres rolled back the insert along with it -- there's
+			// nothing to roll back, which isn't itself an error.
+			if rbErr := d.Rollback(ctx); rbErr != nil && !errors.Is(rbErr, errNoActiveMigration) {
+				return fmt.Errorf("failed to apply migration %s: %w (rollback also failed: %s)", migration.Name, err, rbErr)
+			}
+			return fmt.Errorf("failed to apply migration %s: %w", migration.Name, err)
 		}
-		if err := d.recreateView(ctx, table); err != nil {
-			return fmt.Errorf("recreateView: %w", err)
+		if err := d.Complete(ctx); err != nil {
+			// The migration was applied but never marked done, so it's still
+			// the active row and migrations_one_active_idx would block every
+			// future Apply. Roll it back now rather than leaving history
+			// setup permanently stuck until someone does this by hand.
+			if rbErr := d.Rollback(ctx); rbErr != nil {
+				return fmt.Errorf("failed to complete migration %s: %w (rollback also failed: %s)", migration.Name, err, rbErr)
+			}
+			return fmt.Errorf("failed to complete migration %s, rolled back: %w", migration.Name, err)
 		}
 	}
 
 	return nil
 }
 
-// DropViews drops all hypertable related views. This must be called before any migrations can be run.
-func (d *DDLManager) DropViews(ctx context.Context) error {
+// DropViews drops all hypertable related views (and continuous aggregates, if
+// configured). This must be called before any migrations can be run.
+// Point-in-time snapshot views (see CreateSnapshotView) are left alone unless
+// includeSnapshots is true, so routine migrations don't wipe out views users
+// created for drift detection.
+func (d *DDLManager) DropViews(ctx context.Context, includeSnapshots bool) error {
 	var tables []string
 	if err := pgxscan.Select(ctx, d.pool, &tables, listHyperTables, history.SchemaName); err != nil {
 		return fmt.Errorf("failed to list hypertables: %w", err)
 	}
 
+	// DROP MATERIALIZED VIEW ... on a continuous aggregate cannot run inside a
+	// transaction block, so it has to happen via a plain Exec before the
+	// transactional view drops below. Neither view depends on the other --
+	// the continuous aggregate and the plain "latest" view both select
+	// directly from history."<table>", not from each other -- so dropping it
+	// first rather than interleaved with the rest is safe.
+	if d.cfg.ContinuousAggregates.Enable {
+		for _, table := range tables {
+			cagg := caggViewName(table, d.cfg.ContinuousAggregates.BucketFor(table))
+			if _, err := d.pool.Exec(ctx, fmt.Sprintf(dropContinuousAggregate, cagg)); err != nil {
+				return fmt.Errorf("failed to drop continuous aggregate for table: %w", err)
+			}
+		}
+	}
+
 	if err := d.pool.BeginTxFunc(ctx, pgx.TxOptions{}, func(tx pgx.Tx) error {
 		for _, table := range tables {
 			if _, err := tx.Exec(ctx, fmt.Sprintf(dropTableView, table)); err != nil {
 				return fmt.Errorf("failed to drop view for table: %w", err)
 			}
+
+			if includeSnapshots {
+				labels, err := d.ListSnapshotViews(ctx, table)
+				if err != nil {
+					return fmt.Errorf("failed to list snapshot views for table: %w", err)
+				}
+				for _, label := range labels {
+					if _, err := tx.Exec(ctx, dropView, snapshotViewName(table, label)); err != nil {
+						return fmt.Errorf("failed to drop snapshot view for table: %w", err)
+					}
+				}
+			}
 		}
 		return nil
 	}); err != nil {
@@ -97,6 +251,15 @@ func (d *DDLManager) AddHistoryFunctions(ctx context.Context) error {
 		if _, err := tx.Exec(ctx, createHistorySchema); err != nil {
 			return err
 		}
+		if _, err := tx.Exec(ctx, createMigrationsTable); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, createActiveMigrationIndex); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, createRootMigrationIndex); err != nil {
+			return err
+		}
 		if _, err := tx.Exec(ctx, setupTriggerFunction); err != nil {
 			return err
 		}
@@ -106,53 +269,263 @@ func (d *DDLManager) AddHistoryFunctions(ctx context.Context) error {
 		if _, err := tx.Exec(ctx, defineRetentionFunction); err != nil {
 			return err
 		}
+		if _, err := tx.Exec(ctx, defineCompressionFunction); err != nil {
+			return err
+		}
 		if _, err := tx.Exec(ctx, cascadeDeleteFunction); err != nil {
 			return err
 		}
 		if _, err := tx.Exec(ctx, findLatestFetchDate); err != nil {
 			return err
 		}
+		if _, err := tx.Exec(ctx, findAtFetchDate); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, createSnapshotViewFunction); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, dropViewFunction); err != nil {
+			return err
+		}
 		return nil
 	})
 }
 
-func (d *DDLManager) configureHyperTable(ctx context.Context, tableName string) error {
-	tName := fmt.Sprintf(`"%s"."%s"`, history.SchemaName, tableName)
+// hyperTableSchema is the config state recorded as a migration's
+// ResultingSchema. Unlike a free-form snapshot, it is parsed back out of the
+// previous migration's ResultingSchema by planHyperTableMigration, both to
+// decide whether anything changed (skip emitting a no-op migration) and to
+// build a genuine Inverse that restores the prior settings, not just tears
+// down what the new migration created.
+type hyperTableSchema struct {
+	Table                  string                     `json:"table"`
+	ChunkTimeIntervalHours int                        `json:"chunk_time_interval_hours"`
+	RetentionInterval      string                     `json:"retention_interval"`
+	RetentionTimezone      string                     `json:"retention_timezone"`
+	Compression            *compressionSchema         `json:"compression,omitempty"`
+	ContinuousAggregate    *continuousAggregateSchema `json:"continuous_aggregate,omitempty"`
+}
 
-	if _, err := d.pool.Exec(ctx, fmt.Sprintf(setChunkTimeInterval, d.cfg.TimeInterval), tName); err != nil {
-		return err
+type compressionSchema struct {
+	CompressAfter string `json:"compress_after"`
+	SegmentBy     string `json:"segmentby"`
+	OrderBy       string `json:"orderby"`
+}
+
+type continuousAggregateSchema struct {
+	View            string `json:"view"`
+	Bucket          string `json:"bucket"`
+	RefreshLag      string `json:"refresh_lag"`
+	RefreshInterval string `json:"refresh_interval"`
+}
+
+// desiredHyperTableSchema computes the hyperTableSchema table should have
+// under the current config.
+func (d *DDLManager) desiredHyperTableSchema(table string) hyperTableSchema {
+	s := hyperTableSchema{
+		Table:                  table,
+		ChunkTimeIntervalHours: d.cfg.TimeInterval,
+		RetentionInterval:      d.cfg.Retention.IntervalLiteral(),
+		RetentionTimezone:      d.cfg.Retention.TimezoneOrDefault(),
 	}
-	d.log.Debug("updated chunk_time_interval for table", "table", tableName, "interval", d.cfg.TimeInterval)
 
-	// Below call is only needed for "parent" tables. dataRetentionPolicy function takes care of that by updating retention ONLY IF a previous retention policy is set.
-	if _, err := d.pool.Exec(ctx, fmt.Sprintf(dataRetentionPolicy, d.cfg.Retention), tName); err != nil {
-		return err
+	if d.cfg.Compression.Enable {
+		s.Compression = &compressionSchema{
+			CompressAfter: d.cfg.Compression.CompressAfterFor(table),
+			SegmentBy:     d.cfg.Compression.SegmentByFor(table),
+			OrderBy:       d.cfg.Compression.OrderByFor(table),
+		}
 	}
 
-	d.log.Debug("created data retention policy", "table", tableName, "days", d.cfg.Retention)
-	return nil
+	if d.cfg.ContinuousAggregates.Enable {
+		bucket := d.cfg.ContinuousAggregates.BucketFor(table)
+		refreshLag := d.cfg.ContinuousAggregates.RefreshLag
+		if refreshLag == "" {
+			refreshLag = bucket
+		}
+		refreshInterval := d.cfg.ContinuousAggregates.RefreshInterval
+		if refreshInterval == "" {
+			refreshInterval = bucket
+		}
+		s.ContinuousAggregate = &continuousAggregateSchema{
+			View:            caggViewName(table, bucket),
+			Bucket:          bucket,
+			RefreshLag:      refreshLag,
+			RefreshInterval: refreshInterval,
+		}
+	}
+
+	return s
 }
 
-func (d *DDLManager) recreateView(ctx context.Context, table string) error {
-	if err := d.pool.BeginTxFunc(ctx, pgx.TxOptions{}, func(tx pgx.Tx) error {
-		// Must drop the view first -- CREATE OR REPLACE view won't cut it if columns are changed. PostgreSQL doc states:
-		// > The new query must generate the same columns that were generated by the existing view query (that is, the same column names in the same order and with
-		// > the same data types), but it may add additional columns to the end of the list.
-		// ref: https://www.postgresql.org/docs/14/sql-createview.html
+// chunkAndRetentionDDL returns the set_chunk_time_interval/update_retention
+// statements that bring table to s's chunk interval and retention.
+func chunkAndRetentionDDL(tName string, s hyperTableSchema) []string {
+	return []string{
+		fmt.Sprintf(setChunkTimeInterval, tName, s.ChunkTimeIntervalHours),
+		// Below call is only needed for "parent" tables. update_retention takes
+		// care of that by updating retention ONLY IF a previous retention policy is set.
+		fmt.Sprintf(dataRetentionPolicy, tName, s.RetentionInterval, s.RetentionTimezone),
+	}
+}
 
-		if _, err := tx.Exec(ctx, fmt.Sprintf(dropTableView, table)); err != nil {
-			return fmt.Errorf("failed to drop view for table: %w", err)
-		}
+// compressionDDL returns the ALTER TABLE/update_compression statements that
+// set up c, or nil if c is nil (compression not enabled).
+func compressionDDL(tName string, c *compressionSchema) []string {
+	if c == nil {
+		return nil
+	}
+	return []string{
+		fmt.Sprintf(compressHyperTable, tName, c.SegmentBy, c.OrderBy),
+		fmt.Sprintf(compressionPolicy, tName, c.CompressAfter),
+	}
+}
+
+// planHyperTableMigration builds the forward/inverse DDL bundle that brings
+// table's chunk interval, retention, view, compression and continuous
+// aggregates in line with the current config. prevSchema is the
+// resulting_schema of the last completed migration for table (nil if there
+// isn't one yet). It returns nil if the desired schema is identical to
+// prevSchema, so SetupHistory doesn't record a no-op migration on every
+// boot. It does not execute anything; callers apply it through
+// Apply/Complete (see migrations.go).
+func (d *DDLManager) planHyperTableMigration(table string, prevSchema json.RawMessage) *Migration {
+	next := d.desiredHyperTableSchema(table)
 
-		if _, err := tx.Exec(ctx, fmt.Sprintf(createTableView, table)); err != nil {
-			return fmt.Errorf("failed to create view for table: %w", err)
+	var prev hyperTableSchema
+	havePrev := len(prevSchema) > 0
+	if havePrev {
+		if err := json.Unmarshal(prevSchema, &prev); err != nil {
+			havePrev = false
 		}
+		// A genuine hyperTableSchema always has these set, so their absence
+		// means prevSchema predates this shape (e.g. the old flat
+		// "chunk_time_interval"/"retention" keys) rather than representing a
+		// hypertable actually migrated with a zero interval and no
+		// retention. Treating it as unparseable, like the error case above,
+		// avoids planning an Inverse that would restore a bogus empty state.
+		if prev.ChunkTimeIntervalHours == 0 || prev.RetentionInterval == "" {
+			havePrev = false
+		}
+	}
+	if !havePrev {
+		// Best-effort: treat an absent/unrecognized prior schema like there
+		// was none, so the migration is still applied, just without a
+		// genuine Inverse back to it.
+		prev = hyperTableSchema{}
+	}
 
+	if havePrev && reflect.DeepEqual(prev, next) {
 		return nil
-	}); err != nil {
-		return fmt.Errorf("tx failed for %s: %w", table, err)
 	}
-	return nil
+
+	tName := fmt.Sprintf(`"%s"."%s"`, history.SchemaName, table)
+
+	forward := chunkAndRetentionDDL(tName, next)
+	// Must drop the view first -- CREATE OR REPLACE view won't cut it if columns are changed. PostgreSQL doc states:
+	// > The new query must generate the same columns that were generated by the existing view query (that is, the same column names in the same order and with
+	// > the same data types), but it may add additional columns to the end of the list.
+	// ref: https://www.postgresql.org/docs/14/sql-createview.html
+	forward = append(forward, fmt.Sprintf(dropTableView, table), fmt.Sprintf(createTableView, table))
+	if next.Compression != nil {
+		forward = append(forward, compressionDDL(tName, next.Compression)...)
+	} else if havePrev && prev.Compression != nil {
+		// Compression was turned off in config -- stop the policy job.
+		// Chunks the prior migration already compressed stay compressed, as
+		// with removeCompressionPolicy's use in Inverse below.
+		forward = append(forward, fmt.Sprintf(removeCompressionPolicy, tName))
+	}
+
+	var inverse []string
+	switch {
+	case havePrev:
+		// A prior CloudQuery-managed state exists for this table, so Inverse
+		// can genuinely restore it, not just tear down what forward created.
+		inverse = chunkAndRetentionDDL(tName, prev)
+		inverse = append(inverse, fmt.Sprintf(dropTableView, table), fmt.Sprintf(createTableView, table))
+		if prev.Compression != nil {
+			inverse = append(inverse, compressionDDL(tName, prev.Compression)...)
+		} else if next.Compression != nil {
+			// Compression is being enabled for the first time -- there is no
+			// prior policy to restore, so the best available undo stops it
+			// (see removeCompressionPolicy).
+			inverse = append(inverse, fmt.Sprintf(removeCompressionPolicy, tName))
+		}
+	default:
+		// This is the first migration CloudQuery has recorded for table --
+		// there is no prior managed state to restore the chunk interval,
+		// retention or compression settings to, so Inverse only tears down
+		// the view this migration creates.
+		inverse = []string{fmt.Sprintf(dropTableView, table)}
+	}
+
+	var nonTx, inverseNonTx []string
+	switch {
+	case next.ContinuousAggregate != nil:
+		cagg := next.ContinuousAggregate
+		changed := !havePrev || prev.ContinuousAggregate == nil || prev.ContinuousAggregate.View != cagg.View
+
+		// CREATE/DROP MATERIALIZED VIEW ... WITH (timescaledb.continuous)
+		// cannot run inside a transaction block, so these go in
+		// NonTransactional/InverseNonTransactional instead of
+		// forward/inverse -- see Apply in migrations.go.
+		//
+		// The cagg is created WITH NO DATA, so dropping and recreating it
+		// wipes the rollup until the refresh policy happens to repopulate
+		// it -- only do that when its definition (view name, which encodes
+		// the bucket) actually changed since the last completed migration.
+		if changed {
+			nonTx = append(nonTx,
+				fmt.Sprintf(dropContinuousAggregate, cagg.View),
+				fmt.Sprintf(createContinuousAggregate, cagg.View, cagg.Bucket, table),
+			)
+			inverseNonTx = append(inverseNonTx, fmt.Sprintf(dropContinuousAggregate, cagg.View))
+			if havePrev && prev.ContinuousAggregate != nil {
+				// Recreate the cagg this migration replaced, under its own
+				// name/bucket, so Rollback restores the prior rollup.
+				inverseNonTx = append(inverseNonTx,
+					fmt.Sprintf(createContinuousAggregate, prev.ContinuousAggregate.View, prev.ContinuousAggregate.Bucket, table),
+					fmt.Sprintf(addContinuousAggregatePolicy, prev.ContinuousAggregate.View, prev.ContinuousAggregate.RefreshLag, prev.ContinuousAggregate.RefreshInterval),
+				)
+			}
+		}
+		// start_offset => NULL means the refresh job has no lower bound, so
+		// the first refresh after CREATE ... WITH NO DATA backfills the cagg
+		// from the beginning of the hypertable rather than leaving it empty.
+		nonTx = append(nonTx, fmt.Sprintf(addContinuousAggregatePolicy, cagg.View, cagg.RefreshLag, cagg.RefreshInterval))
+	case havePrev && prev.ContinuousAggregate != nil:
+		// Continuous aggregates were disabled in config since the last
+		// migration -- tear down the one that existed, and restore it on
+		// Rollback.
+		nonTx = append(nonTx, fmt.Sprintf(dropContinuousAggregate, prev.ContinuousAggregate.View))
+		inverseNonTx = append(inverseNonTx,
+			fmt.Sprintf(createContinuousAggregate, prev.ContinuousAggregate.View, prev.ContinuousAggregate.Bucket, table),
+			fmt.Sprintf(addContinuousAggregatePolicy, prev.ContinuousAggregate.View, prev.ContinuousAggregate.RefreshLag, prev.ContinuousAggregate.RefreshInterval),
+		)
+	}
+
+	schema, err := json.Marshal(next)
+	if err != nil {
+		// hyperTableSchema only contains strings/ints/nested structs of the
+		// same, so this can't fail.
+		panic(fmt.Sprintf("failed to marshal resulting schema for table %s: %s", table, err))
+	}
+
+	return &Migration{
+		Name:                    fmt.Sprintf("setup-history:%s@%d", table, time.Now().UnixNano()),
+		Forward:                 forward,
+		Inverse:                 inverse,
+		NonTransactional:        nonTx,
+		InverseNonTransactional: inverseNonTx,
+		ResultingSchema:         schema,
+	}
+}
+
+// caggViewName derives the materialized view name for a table's continuous
+// aggregate at the given bucket width, e.g. ("aws_iam_users", "1 day") ->
+// "aws_iam_users_cagg_1_day".
+func caggViewName(table, bucket string) string {
+	return fmt.Sprintf("%s_cagg_%s", table, strings.ReplaceAll(bucket, " ", "_"))
 }
 
 const (
@@ -214,9 +587,18 @@ const (
 				END;
 				$BODY$;`
 
-	// Updates the retention policy on the given table, only if a policy already exists.
+	// Updates the retention policy on the given table, only if a policy already
+	// exists. _timezone is passed through to add_retention_policy's own
+	// timezone argument -- which add_retention_policy only accepts starting in
+	// TimescaleDB 2.8 -- so it is omitted entirely when _timezone is UTC
+	// (NewDDLManager's TimescaleDB 2.8 check only fires for month/year
+	// retention units or a non-UTC timezone, so a plain day/week config in UTC
+	// must keep working against
+	// whatever TimescaleDB version the user already has). TimescaleDB
+	// retention always drops whole chunks, so the window is still rounded up
+	// to the next chunk boundary regardless of _retention/_timezone.
 	defineRetentionFunction = `
-				CREATE OR REPLACE FUNCTION history.update_retention(_table_name text, _retention interval)
+				CREATE OR REPLACE FUNCTION history.update_retention(_table_name text, _retention interval, _timezone text)
 					RETURNS integer
 					LANGUAGE 'plpgsql'
 					COST 100
@@ -227,7 +609,11 @@ const (
 				BEGIN
 					IF EXISTS ( SELECT 1 FROM timescaledb_information.jobs WHERE proc_name = 'policy_retention' AND hypertable_name = _table_name) THEN
 						PERFORM remove_retention_policy(_table_name, if_exists => true);
-						SELECT add_retention_policy(_table_name, _retention, if_not_exists => true) INTO result;
+						IF _timezone IS NULL OR _timezone = 'UTC' THEN
+							SELECT add_retention_policy(_table_name, _retention, if_not_exists => true) INTO result;
+						ELSE
+							SELECT add_retention_policy(_table_name, _retention, if_not_exists => true, timezone => _timezone) INTO result;
+						END IF;
 						RETURN result;
 					ELSE
 						RETURN -2;
@@ -235,6 +621,28 @@ const (
 				END;
 				$BODY$;`
 
+	// Updates the compression policy on the given table, mirroring
+	// update_retention. Unlike retention, no compression policy is
+	// provisioned when the hypertable is created, so -- unlike
+	// update_retention -- this also creates the policy on its first call.
+	defineCompressionFunction = `
+				CREATE OR REPLACE FUNCTION history.update_compression(_table_name text, _compress_after interval)
+					RETURNS integer
+					LANGUAGE 'plpgsql'
+					COST 100
+					VOLATILE PARALLEL UNSAFE
+				AS $BODY$
+				DECLARE
+					result integer;
+				BEGIN
+					IF EXISTS ( SELECT 1 FROM timescaledb_information.jobs WHERE proc_name = 'policy_compression' AND hypertable_name = _table_name) THEN
+						PERFORM remove_compression_policy(_table_name, if_exists => true);
+					END IF;
+					SELECT add_compression_policy(_table_name, _compress_after, if_not_exists => true) INTO result;
+					RETURN result;
+				END;
+				$BODY$;`
+
 	findLatestFetchDate = `
 			CREATE OR REPLACE FUNCTION find_latest(schema TEXT, _table_name TEXT) 
 			RETURNS timestamp without time zone AS $body$
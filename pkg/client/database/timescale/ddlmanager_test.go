@@ -0,0 +1,56 @@
+package timescale
+
+import "testing"
+
+func TestMajorMinor(t *testing.T) {
+	cases := []struct {
+		name      string
+		version   string
+		wantMajor int
+		wantMinor int
+		wantErr   bool
+	}{
+		{name: "major.minor", version: "2.8", wantMajor: 2, wantMinor: 8},
+		{name: "major.minor.patch", version: "2.8.1", wantMajor: 2, wantMinor: 8},
+		{name: "missing minor", version: "2", wantErr: true},
+		{name: "non-numeric major", version: "a.8", wantErr: true},
+		{name: "non-numeric minor", version: "2.b", wantErr: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			major, minor, err := majorMinor(tc.version)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if major != tc.wantMajor || minor != tc.wantMinor {
+				t.Fatalf("got (%d, %d), want (%d, %d)", major, minor, tc.wantMajor, tc.wantMinor)
+			}
+		})
+	}
+}
+
+func TestCaggViewName(t *testing.T) {
+	cases := []struct {
+		table  string
+		bucket string
+		want   string
+	}{
+		{table: "aws_iam_users", bucket: "1 day", want: "aws_iam_users_cagg_1_day"},
+		{table: "aws_iam_users", bucket: "1 hour", want: "aws_iam_users_cagg_1_hour"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.want, func(t *testing.T) {
+			if got := caggViewName(tc.table, tc.bucket); got != tc.want {
+				t.Fatalf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,290 @@
+package timescale
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/georgysavva/scany/pgxscan"
+	"github.com/jackc/pgx/v4"
+)
+
+const (
+	createMigrationsTable = `
+		CREATE TABLE IF NOT EXISTS history.migrations (
+			name             TEXT PRIMARY KEY,
+			migration        JSONB NOT NULL,
+			created_at       TIMESTAMPTZ NOT NULL DEFAULT now(),
+			parent           TEXT REFERENCES history.migrations(name),
+			done             BOOL NOT NULL DEFAULT false,
+			resulting_schema JSONB
+		);`
+
+	// Only one migration may be in flight (applied but not yet completed or
+	// rolled back) at a time.
+	createActiveMigrationIndex = `
+		CREATE UNIQUE INDEX IF NOT EXISTS migrations_one_active_idx ON history.migrations ((true)) WHERE done = false;`
+
+	// Only the first migration in the chain may have no parent.
+	createRootMigrationIndex = `
+		CREATE UNIQUE INDEX IF NOT EXISTS migrations_one_root_idx ON history.migrations ((true)) WHERE parent IS NULL;`
+
+	selectLatestDoneMigration     = `SELECT name FROM history.migrations WHERE done = true ORDER BY created_at DESC LIMIT 1`
+	selectLatestDoneMigrationBody = `SELECT name, migration FROM history.migrations WHERE done = true ORDER BY created_at DESC LIMIT 1`
+	selectActiveMigration         = `SELECT name, migration FROM history.migrations WHERE done = false LIMIT 1`
+
+	selectLatestResultingSchemaForTable = `
+		SELECT resulting_schema FROM history.migrations
+		WHERE done = true AND resulting_schema ->> 'table' = $1
+		ORDER BY created_at DESC LIMIT 1`
+	insertMigration   = `INSERT INTO history.migrations (name, migration, parent, resulting_schema) VALUES ($1, $2, $3, $4)`
+	completeMigration = `UPDATE history.migrations SET done = true WHERE name = $1`
+	deleteMigration   = `DELETE FROM history.migrations WHERE name = $1`
+)
+
+// migrationBody is the JSONB payload stored in history.migrations.migration:
+// the forward and inverse DDL statements that make up the bundle.
+type migrationBody struct {
+	Forward                 []string `json:"forward"`
+	Inverse                 []string `json:"inverse"`
+	NonTransactional        []string `json:"non_transactional,omitempty"`
+	InverseNonTransactional []string `json:"inverse_non_transactional,omitempty"`
+}
+
+// Migration is a named, reversible bundle of history DDL. It is the unit
+// Apply, Complete and Rollback operate on.
+type Migration struct {
+	// Name uniquely identifies this migration in history.migrations.
+	Name string
+	// Forward is the DDL executed by Apply inside the migration transaction,
+	// in order.
+	Forward []string
+	// Inverse is the DDL executed by Rollback inside a transaction, in
+	// order, to undo Forward.
+	Inverse []string
+	// NonTransactional is DDL that cannot run inside a transaction block --
+	// currently just the continuous aggregate CREATE/DROP MATERIALIZED VIEW
+	// statements, which TimescaleDB rejects inside BeginTxFunc -- executed
+	// via plain pool.Exec after Forward's transaction commits.
+	NonTransactional []string
+	// InverseNonTransactional undoes NonTransactional, executed by Rollback
+	// outside a transaction alongside Inverse.
+	InverseNonTransactional []string
+	// ResultingSchema is a JSON snapshot of the hypertable/view/policy state
+	// this migration produces, stored alongside the migration for auditing.
+	ResultingSchema json.RawMessage
+}
+
+// errNoActiveMigration is returned by Complete and Rollback when there is no
+// in-flight migration to act on.
+var errNoActiveMigration = errors.New("no migration in progress")
+
+// errNoCompletedMigration is returned by RollbackCompleted when no migration
+// has ever been completed.
+var errNoCompletedMigration = errors.New("no completed migration to roll back")
+
+// Apply records m as the new in-flight migration -- chained off the latest
+// completed migration -- and executes its forward DDL. Forward runs inside
+// one transaction; NonTransactional then runs via plain pool.Exec, since
+// TimescaleDB refuses to create or drop a continuous aggregate inside a
+// transaction block. The partial unique index on done=false means only one
+// migration can be in flight at a time; call Complete to finish it, or
+// Rollback to undo it, before calling Apply again.
+func (d *DDLManager) Apply(ctx context.Context, m Migration) error {
+	parent, err := d.latestDoneMigration(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to find latest migration: %w", err)
+	}
+
+	body, err := json.Marshal(migrationBody{
+		Forward:                 m.Forward,
+		Inverse:                 m.Inverse,
+		NonTransactional:        m.NonTransactional,
+		InverseNonTransactional: m.InverseNonTransactional,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal migration %s: %w", m.Name, err)
+	}
+
+	var parentArg interface{}
+	if parent != "" {
+		parentArg = parent
+	}
+
+	if err := d.pool.BeginTxFunc(ctx, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, insertMigration, m.Name, body, parentArg, m.ResultingSchema); err != nil {
+			return fmt.Errorf("failed to record migration %s: %w", m.Name, err)
+		}
+		for _, stmt := range m.Forward {
+			if _, err := tx.Exec(ctx, stmt); err != nil {
+				return fmt.Errorf("failed to apply migration %s: %w", m.Name, err)
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	// The migration row is already committed as the active one, so a failure
+	// here leaves it in flight rather than rolled back -- the same recovery
+	// path as a Complete failure: call Rollback to undo it before retrying.
+	for _, stmt := range m.NonTransactional {
+		if _, err := d.pool.Exec(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to apply migration %s: %w", m.Name, err)
+		}
+	}
+	return nil
+}
+
+// Complete marks the currently in-flight migration as done, so it becomes
+// the parent of the next Apply.
+func (d *DDLManager) Complete(ctx context.Context) error {
+	name, _, err := d.activeMigration(ctx)
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		return errNoActiveMigration
+	}
+	if _, err := d.pool.Exec(ctx, completeMigration, name); err != nil {
+		return fmt.Errorf("failed to complete migration %s: %w", name, err)
+	}
+	return nil
+}
+
+// Rollback undoes the currently in-flight migration by executing its
+// inverse DDL (both the transactional Inverse and, like Apply, the
+// NonTransactional continuous-aggregate DDL run separately via plain
+// pool.Exec) and removing it from the ledger, restoring the latest
+// completed migration as the tip of the chain. It returns
+// errNoActiveMigration if there is no in-flight migration -- e.g. Apply
+// itself failed before committing one.
+//
+// To undo a migration that has already been completed -- the common case,
+// since SetupHistory always calls Complete right after Apply -- use
+// RollbackCompleted instead.
+func (d *DDLManager) Rollback(ctx context.Context) error {
+	name, body, err := d.activeMigration(ctx)
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		return errNoActiveMigration
+	}
+	return d.rollbackMigration(ctx, name, body)
+}
+
+// RollbackCompleted undoes the most recently completed migration, executing
+// its stored Inverse/InverseNonTransactional DDL and removing it from the
+// ledger so the migration before it becomes the tip of the chain again. It
+// refuses to run while a migration is in flight, since the in-flight
+// migration's parent reference would then point at a deleted row. It
+// returns errNoCompletedMigration if no migration has ever been completed.
+func (d *DDLManager) RollbackCompleted(ctx context.Context) error {
+	activeName, _, err := d.activeMigration(ctx)
+	if err != nil {
+		return err
+	}
+	if activeName != "" {
+		return fmt.Errorf("cannot roll back a completed migration while %s is in flight: complete or roll it back first", activeName)
+	}
+
+	name, body, err := d.latestDoneMigrationBody(ctx)
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		return errNoCompletedMigration
+	}
+	return d.rollbackMigration(ctx, name, body)
+}
+
+// rollbackMigration executes the inverse DDL of the named migration (body)
+// and removes it from the ledger. It is shared by Rollback, which acts on
+// the in-flight migration, and RollbackCompleted, which acts on the latest
+// completed one -- the undo mechanics are identical, only how the target
+// migration is found differs.
+func (d *DDLManager) rollbackMigration(ctx context.Context, name string, body migrationBody) error {
+	for _, stmt := range body.InverseNonTransactional {
+		if _, err := d.pool.Exec(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to roll back migration %s: %w", name, err)
+		}
+	}
+
+	return d.pool.BeginTxFunc(ctx, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		for _, stmt := range body.Inverse {
+			if _, err := tx.Exec(ctx, stmt); err != nil {
+				return fmt.Errorf("failed to roll back migration %s: %w", name, err)
+			}
+		}
+		if _, err := tx.Exec(ctx, deleteMigration, name); err != nil {
+			return fmt.Errorf("failed to remove migration %s from ledger: %w", name, err)
+		}
+		return nil
+	})
+}
+
+// latestDoneMigration returns the name of the most recently completed
+// migration, or "" if none has been applied yet.
+func (d *DDLManager) latestDoneMigration(ctx context.Context) (string, error) {
+	var name string
+	if err := pgxscan.Get(ctx, d.pool, &name, selectLatestDoneMigration); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", nil
+		}
+		return "", err
+	}
+	return name, nil
+}
+
+// latestResultingSchemaForTable returns the resulting_schema recorded by the
+// most recently completed migration for table, or nil if there is none yet.
+// Callers use this to diff the previous schema against a freshly planned
+// migration, so that steps whose definition hasn't changed can be skipped.
+func (d *DDLManager) latestResultingSchemaForTable(ctx context.Context, table string) (json.RawMessage, error) {
+	var schema json.RawMessage
+	if err := pgxscan.Get(ctx, d.pool, &schema, selectLatestResultingSchemaForTable, table); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to find latest resulting schema for table %s: %w", table, err)
+	}
+	return schema, nil
+}
+
+// activeMigration returns the name and body of the migration currently in
+// flight (applied but not yet completed or rolled back), or "" if there is
+// none.
+func (d *DDLManager) activeMigration(ctx context.Context) (string, migrationBody, error) {
+	return d.migrationBodyByQuery(ctx, selectActiveMigration, "active")
+}
+
+// latestDoneMigrationBody returns the name and body of the most recently
+// completed migration, or "" if none has been completed yet.
+func (d *DDLManager) latestDoneMigrationBody(ctx context.Context) (string, migrationBody, error) {
+	return d.migrationBodyByQuery(ctx, selectLatestDoneMigrationBody, "latest done")
+}
+
+// migrationBodyByQuery runs query (expected to select a single name/migration
+// row) and unmarshals its migration column, returning ("", migrationBody{},
+// nil) if it matches no rows. desc names the migration being looked up, for
+// error messages.
+func (d *DDLManager) migrationBodyByQuery(ctx context.Context, query, desc string) (string, migrationBody, error) {
+	var row struct {
+		Name      string          `db:"name"`
+		Migration json.RawMessage `db:"migration"`
+	}
+	if err := pgxscan.Get(ctx, d.pool, &row, query); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", migrationBody{}, nil
+		}
+		return "", migrationBody{}, fmt.Errorf("failed to find %s migration: %w", desc, err)
+	}
+
+	var body migrationBody
+	if err := json.Unmarshal(row.Migration, &body); err != nil {
+		return "", migrationBody{}, fmt.Errorf("failed to unmarshal migration %s: %w", row.Name, err)
+	}
+	return row.Name, body, nil
+}
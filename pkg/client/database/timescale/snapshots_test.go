@@ -0,0 +1,23 @@
+package timescale
+
+import "testing"
+
+func TestLikeEscape(t *testing.T) {
+	cases := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "underscores", in: "aws_iam_users__", want: `aws\_iam\_users\_\_`},
+		{name: "percent sign", in: "100%_done", want: `100\%\_done`},
+		{name: "backslash", in: `a\b`, want: `a\\b`},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := likeEscape(tc.in); got != tc.want {
+				t.Fatalf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
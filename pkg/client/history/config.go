@@ -0,0 +1,258 @@
+package history
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+)
+
+// SchemaName is the postgres schema that all history tables, views and
+// functions live under.
+const SchemaName = "history"
+
+// defaultBucket is used when a ContinuousAggregateConfig doesn't specify one.
+const defaultBucket = "1 day"
+
+// Config controls how CloudQuery manages history (hypertable) storage for
+// providers that opt into historical fetches.
+type Config struct {
+	// TimeInterval is the chunk_time_interval (in hours) used for every
+	// history hypertable.
+	TimeInterval int `json:"time_interval"`
+	// Retention is how long to keep history per hypertable. It accepts either
+	// a plain number of days (the historical format) or a structured value
+	// (see Retention) for calendar-unit, timezone-aware windows.
+	Retention Retention `json:"retention"`
+	// ContinuousAggregates configures TimescaleDB continuous aggregates
+	// (materialized roll-up views) on top of history hypertables.
+	ContinuousAggregates ContinuousAggregateConfig `json:"continuous_aggregates"`
+	// Compression configures native TimescaleDB compression of older history chunks.
+	Compression CompressionConfig `json:"compression"`
+}
+
+// CompressionConfig controls native TimescaleDB compression of history
+// hypertable chunks older than CompressAfter.
+type CompressionConfig struct {
+	// Enable turns on compression for history hypertables.
+	Enable bool `json:"enable"`
+	// CompressAfter is the default chunk age (e.g. "30 day") after which a
+	// chunk is compressed, used for resources that don't match a more
+	// specific entry in Resources.
+	CompressAfter string `json:"compress_after"`
+	// SegmentBy is the default timescaledb.compress_segmentby hint. Defaults
+	// to "cq_id" if empty.
+	SegmentBy string `json:"segmentby"`
+	// OrderBy is the default timescaledb.compress_orderby hint. Defaults to
+	// "cq_fetch_date DESC" if empty.
+	OrderBy string `json:"orderby"`
+	// Resources maps a resource name or glob (e.g. "aws_iam_*") to overrides
+	// of CompressAfter/SegmentBy/OrderBy for matching tables.
+	Resources map[string]CompressionOverride `json:"resources"`
+}
+
+// CompressionOverride overrides one or more CompressionConfig defaults for a
+// specific resource or glob.
+type CompressionOverride struct {
+	CompressAfter string `json:"compress_after"`
+	SegmentBy     string `json:"segmentby"`
+	OrderBy       string `json:"orderby"`
+}
+
+const (
+	defaultCompressAfter = "30 day"
+	defaultSegmentBy     = "cq_id"
+	defaultOrderBy       = "cq_fetch_date DESC"
+)
+
+// RetentionUnit is one of the calendar units a Retention window can be
+// expressed in. Month and year require TimescaleDB >= 2.8 (see
+// Retention.RequiresTimescaleDB28).
+type RetentionUnit string
+
+const (
+	RetentionDay   RetentionUnit = "day"
+	RetentionWeek  RetentionUnit = "week"
+	RetentionMonth RetentionUnit = "month"
+	RetentionYear  RetentionUnit = "year"
+)
+
+const defaultRetentionTimezone = "UTC"
+
+// Retention describes how long to keep history for a hypertable. It can be
+// configured either as a plain integer (legacy "number of days" behavior) or
+// as a structured {amount, unit, timezone} value, e.g.
+//
+//	{"amount": 12, "unit": "month", "timezone": "America/New_York"}
+//
+// The retention window is always rounded up to the next chunk boundary --
+// TimescaleDB's retention policy only ever drops whole chunks, never part of
+// one -- so the configured amount is a lower bound on how much history is
+// kept, not an exact cutoff.
+type Retention struct {
+	Amount   int           `json:"amount"`
+	Unit     RetentionUnit `json:"unit"`
+	Timezone string        `json:"timezone"`
+}
+
+// UnmarshalJSON accepts either a bare integer (interpreted as a number of
+// days) or a {amount, unit, timezone} object.
+func (r *Retention) UnmarshalJSON(data []byte) error {
+	var days int
+	if err := json.Unmarshal(data, &days); err == nil {
+		r.Amount = days
+		r.Unit = RetentionDay
+		r.Timezone = defaultRetentionTimezone
+		return nil
+	}
+
+	type retentionAlias Retention
+	var alias retentionAlias
+	if err := json.Unmarshal(data, &alias); err != nil {
+		return fmt.Errorf("retention must be an integer number of days or an {amount, unit, timezone} object: %w", err)
+	}
+
+	*r = Retention(alias)
+	if r.Unit == "" {
+		r.Unit = RetentionDay
+	}
+	if r.Timezone == "" {
+		r.Timezone = defaultRetentionTimezone
+	}
+	return nil
+}
+
+// IntervalLiteral renders the retention window as a postgres INTERVAL
+// literal, e.g. "12 month".
+func (r Retention) IntervalLiteral() string {
+	unit := r.Unit
+	if unit == "" {
+		unit = RetentionDay
+	}
+	return fmt.Sprintf("%d %s", r.Amount, unit)
+}
+
+// TimezoneOrDefault returns the configured timezone, defaulting to UTC.
+func (r Retention) TimezoneOrDefault() string {
+	if r.Timezone == "" {
+		return defaultRetentionTimezone
+	}
+	return r.Timezone
+}
+
+// RequiresTimescaleDB28 reports whether this retention window needs
+// TimescaleDB >= 2.8: either a calendar unit (month/year), whose length in
+// days varies and so relies on add_retention_policy's timezone-aware
+// interval handling, or a non-UTC timezone, since the timezone argument to
+// add_retention_policy itself was only added in 2.8.
+func (r Retention) RequiresTimescaleDB28() bool {
+	if r.Unit == RetentionMonth || r.Unit == RetentionYear {
+		return true
+	}
+	return r.Timezone != "" && r.Timezone != defaultRetentionTimezone
+}
+
+func (c CompressionConfig) overrideFor(table string) CompressionOverride {
+	if override, ok := c.Resources[table]; ok {
+		return override
+	}
+	keys := make([]string, 0, len(c.Resources))
+	for pattern := range c.Resources {
+		keys = append(keys, pattern)
+	}
+	if pattern, ok := matchResourceGlob(keys, table); ok {
+		return c.Resources[pattern]
+	}
+	return CompressionOverride{}
+}
+
+// CompressAfterFor returns the compress_after interval for the given table.
+func (c CompressionConfig) CompressAfterFor(table string) string {
+	if override := c.overrideFor(table); override.CompressAfter != "" {
+		return override.CompressAfter
+	}
+	if c.CompressAfter != "" {
+		return c.CompressAfter
+	}
+	return defaultCompressAfter
+}
+
+// SegmentByFor returns the compress_segmentby hint for the given table.
+func (c CompressionConfig) SegmentByFor(table string) string {
+	if override := c.overrideFor(table); override.SegmentBy != "" {
+		return override.SegmentBy
+	}
+	if c.SegmentBy != "" {
+		return c.SegmentBy
+	}
+	return defaultSegmentBy
+}
+
+// OrderByFor returns the compress_orderby hint for the given table.
+func (c CompressionConfig) OrderByFor(table string) string {
+	if override := c.overrideFor(table); override.OrderBy != "" {
+		return override.OrderBy
+	}
+	if c.OrderBy != "" {
+		return c.OrderBy
+	}
+	return defaultOrderBy
+}
+
+// ContinuousAggregateConfig controls creation of TimescaleDB continuous
+// aggregates on history hypertables, bucketed by cq_fetch_date.
+type ContinuousAggregateConfig struct {
+	// Enable turns on continuous aggregate creation during SetupHistory.
+	Enable bool `json:"enable"`
+	// Bucket is the default time_bucket width (e.g. "1 hour", "1 day", "1 week")
+	// used for resources that don't match a more specific entry in Resources.
+	Bucket string `json:"bucket"`
+	// Resources maps a resource name or glob (e.g. "aws_iam_*") to a bucket
+	// width, overriding Bucket for matching tables.
+	Resources map[string]string `json:"resources"`
+	// RefreshLag is how far behind "now" the refresh window ends, passed as
+	// the `end_offset` of add_continuous_aggregate_policy (e.g. "1 hour").
+	RefreshLag string `json:"refresh_lag"`
+	// RefreshInterval is how often the refresh policy job runs (e.g. "1 hour").
+	RefreshInterval string `json:"refresh_interval"`
+}
+
+// BucketFor returns the time_bucket width for the given table, honoring any
+// exact or glob match in Resources before falling back to Bucket.
+func (c ContinuousAggregateConfig) BucketFor(table string) string {
+	if bucket, ok := c.Resources[table]; ok {
+		return bucket
+	}
+	keys := make([]string, 0, len(c.Resources))
+	for pattern := range c.Resources {
+		keys = append(keys, pattern)
+	}
+	if pattern, ok := matchResourceGlob(keys, table); ok {
+		return c.Resources[pattern]
+	}
+	if c.Bucket != "" {
+		return c.Bucket
+	}
+	return defaultBucket
+}
+
+// matchResourceGlob returns the first of patterns (resource glob keys, e.g.
+// from ContinuousAggregateConfig.Resources or CompressionConfig.Resources)
+// that matches table. A pattern equal to table wins over any glob; otherwise
+// patterns is sorted first so that overlapping globs resolve to a
+// deterministic match instead of depending on Go's randomized map iteration
+// order.
+func matchResourceGlob(patterns []string, table string) (string, bool) {
+	for _, pattern := range patterns {
+		if pattern == table {
+			return pattern, true
+		}
+	}
+	sort.Strings(patterns)
+	for _, pattern := range patterns {
+		if ok, err := path.Match(pattern, table); err == nil && ok {
+			return pattern, true
+		}
+	}
+	return "", false
+}
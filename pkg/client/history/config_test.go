@@ -0,0 +1,224 @@
+package history
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestRetentionUnmarshalJSON(t *testing.T) {
+	cases := []struct {
+		name    string
+		input   string
+		want    Retention
+		wantErr bool
+	}{
+		{
+			name:  "bare integer defaults to days in UTC",
+			input: `14`,
+			want:  Retention{Amount: 14, Unit: RetentionDay, Timezone: defaultRetentionTimezone},
+		},
+		{
+			name:  "structured object with all fields",
+			input: `{"amount": 12, "unit": "month", "timezone": "America/New_York"}`,
+			want:  Retention{Amount: 12, Unit: RetentionMonth, Timezone: "America/New_York"},
+		},
+		{
+			name:  "structured object defaults unit to day and timezone to UTC",
+			input: `{"amount": 7}`,
+			want:  Retention{Amount: 7, Unit: RetentionDay, Timezone: defaultRetentionTimezone},
+		},
+		{
+			name:    "neither an integer nor an object",
+			input:   `"14 days"`,
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var got Retention
+			err := json.Unmarshal([]byte(tc.input), &got)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tc.want {
+				t.Fatalf("got %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRetentionRequiresTimescaleDB28(t *testing.T) {
+	cases := []struct {
+		name string
+		r    Retention
+		want bool
+	}{
+		{name: "day in UTC", r: Retention{Unit: RetentionDay, Timezone: "UTC"}, want: false},
+		{name: "week with no timezone set", r: Retention{Unit: RetentionWeek}, want: false},
+		{name: "day with a non-UTC timezone", r: Retention{Unit: RetentionDay, Timezone: "America/New_York"}, want: true},
+		{name: "month in UTC", r: Retention{Unit: RetentionMonth, Timezone: "UTC"}, want: true},
+		{name: "year with no timezone set", r: Retention{Unit: RetentionYear}, want: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.r.RequiresTimescaleDB28(); got != tc.want {
+				t.Fatalf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestMatchResourceGlob(t *testing.T) {
+	cases := []struct {
+		name        string
+		patterns    []string
+		table       string
+		wantPattern string
+		wantOK      bool
+	}{
+		{
+			name:        "exact match preferred regardless of order",
+			patterns:    []string{"aws_*", "aws_iam_users"},
+			table:       "aws_iam_users",
+			wantPattern: "aws_iam_users",
+			wantOK:      true,
+		},
+		{
+			name:        "overlapping globs resolve deterministically by sort order",
+			patterns:    []string{"aws_iam_*", "aws_*"},
+			table:       "aws_iam_users",
+			wantPattern: "aws_*",
+			wantOK:      true,
+		},
+		{
+			name:     "no match",
+			patterns: []string{"gcp_*"},
+			table:    "aws_iam_users",
+			wantOK:   false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			pattern, ok := matchResourceGlob(tc.patterns, tc.table)
+			if ok != tc.wantOK {
+				t.Fatalf("got ok=%v, want %v", ok, tc.wantOK)
+			}
+			if ok && pattern != tc.wantPattern {
+				t.Fatalf("got pattern %q, want %q", pattern, tc.wantPattern)
+			}
+		})
+	}
+}
+
+func TestContinuousAggregateConfigBucketFor(t *testing.T) {
+	cfg := ContinuousAggregateConfig{
+		Bucket: "1 day",
+		Resources: map[string]string{
+			"aws_iam_users": "1 hour",
+			"aws_*":         "1 week",
+		},
+	}
+
+	cases := []struct {
+		name  string
+		table string
+		want  string
+	}{
+		{name: "exact override wins over glob", table: "aws_iam_users", want: "1 hour"},
+		{name: "glob override wins over default", table: "aws_ec2_instances", want: "1 week"},
+		{name: "falls back to default bucket", table: "gcp_compute_instances", want: "1 day"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := cfg.BucketFor(tc.table); got != tc.want {
+				t.Fatalf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+
+	t.Run("falls back to package default when Bucket is unset", func(t *testing.T) {
+		var empty ContinuousAggregateConfig
+		if got := empty.BucketFor("gcp_compute_instances"); got != defaultBucket {
+			t.Fatalf("got %q, want %q", got, defaultBucket)
+		}
+	})
+}
+
+func TestCompressionConfigOverrides(t *testing.T) {
+	cfg := CompressionConfig{
+		CompressAfter: "30 day",
+		SegmentBy:     "cq_id",
+		OrderBy:       "cq_fetch_date DESC",
+		Resources: map[string]CompressionOverride{
+			"aws_iam_users": {CompressAfter: "7 day"},
+			"aws_*":         {SegmentBy: "account_id"},
+		},
+	}
+
+	cases := []struct {
+		name          string
+		table         string
+		compressAfter string
+		segmentBy     string
+		orderBy       string
+	}{
+		{
+			name:          "exact override only touches the field it sets",
+			table:         "aws_iam_users",
+			compressAfter: "7 day",
+			segmentBy:     "cq_id",
+			orderBy:       "cq_fetch_date DESC",
+		},
+		{
+			name:          "glob override only touches the field it sets",
+			table:         "aws_ec2_instances",
+			compressAfter: "30 day",
+			segmentBy:     "account_id",
+			orderBy:       "cq_fetch_date DESC",
+		},
+		{
+			name:          "falls back to config defaults",
+			table:         "gcp_compute_instances",
+			compressAfter: "30 day",
+			segmentBy:     "cq_id",
+			orderBy:       "cq_fetch_date DESC",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := cfg.CompressAfterFor(tc.table); got != tc.compressAfter {
+				t.Fatalf("CompressAfterFor: got %q, want %q", got, tc.compressAfter)
+			}
+			if got := cfg.SegmentByFor(tc.table); got != tc.segmentBy {
+				t.Fatalf("SegmentByFor: got %q, want %q", got, tc.segmentBy)
+			}
+			if got := cfg.OrderByFor(tc.table); got != tc.orderBy {
+				t.Fatalf("OrderByFor: got %q, want %q", got, tc.orderBy)
+			}
+		})
+	}
+
+	t.Run("falls back to package defaults when config is empty", func(t *testing.T) {
+		var empty CompressionConfig
+		if got := empty.CompressAfterFor("gcp_compute_instances"); got != defaultCompressAfter {
+			t.Fatalf("CompressAfterFor: got %q, want %q", got, defaultCompressAfter)
+		}
+		if got := empty.SegmentByFor("gcp_compute_instances"); got != defaultSegmentBy {
+			t.Fatalf("SegmentByFor: got %q, want %q", got, defaultSegmentBy)
+		}
+		if got := empty.OrderByFor("gcp_compute_instances"); got != defaultOrderBy {
+			t.Fatalf("OrderByFor: got %q, want %q", got, defaultOrderBy)
+		}
+	})
+}